@@ -0,0 +1,223 @@
+package main
+
+import (
+	"crypto/md5"
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+
+	gosync "github.com/Redundancy/go-sync"
+	"github.com/Redundancy/go-sync/blocksources"
+	"github.com/Redundancy/go-sync/filechecksum"
+)
+
+// ManifestEntry : ブロックインデックスと強チェックサムの対応
+type ManifestEntry struct {
+	Index      uint
+	StrongHash []byte
+}
+
+// EncodeChecksumIndexWithManifest : EncodeChecksumIndexに加えて(blockIndex -> strongHash)の
+// マニフェストも返す。Content-Addressed Storageへのパブリッシュに使う。
+func EncodeChecksumIndexWithManifest(content io.Reader, fileSize int64, blockSize uint) (io.ReadSeeker, []ManifestEntry, error) {
+	b, err := EncodeChecksumIndex(content, fileSize, blockSize)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	manifest, err := manifestFromEncodedChecksumIndex(b)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if _, err := b.Seek(0, io.SeekStart); err != nil {
+		return nil, nil, err
+	}
+
+	return b, manifest, nil
+}
+
+// manifestFromEncodedChecksumIndex : EncodeChecksumIndexが書いたバイナリ列を読んで
+// ブロックインデックスごとの強チェックサムを取り出す
+func manifestFromEncodedChecksumIndex(r io.ReadSeeker) ([]ManifestEntry, error) {
+	if _, err := r.Seek(0, io.SeekStart); err != nil {
+		return nil, err
+	}
+
+	header := make([]byte, 16)
+	if _, err := io.ReadFull(r, header); err != nil {
+		return nil, err
+	}
+
+	weakSize := int(binary.LittleEndian.Uint32(header[8:12]))
+	strongSize := int(binary.LittleEndian.Uint32(header[12:16]))
+
+	var manifest []ManifestEntry
+	entry := make([]byte, weakSize+strongSize)
+
+	for index := uint(0); ; index++ {
+		_, err := io.ReadFull(r, entry)
+		if err == io.EOF || err == io.ErrUnexpectedEOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		strongHash := make([]byte, strongSize)
+		copy(strongHash, entry[weakSize:])
+		manifest = append(manifest, ManifestEntry{Index: index, StrongHash: strongHash})
+	}
+
+	return manifest, nil
+}
+
+// casObjectPath : 強チェックサムから2階層ファンアウトのCAS上のパスを組み立てる
+func casObjectPath(dir string, strongHash []byte) string {
+	hexHash := hex.EncodeToString(strongHash)
+	if len(hexHash) <= 2 {
+		return filepath.Join(dir, hexHash)
+	}
+	return filepath.Join(dir, hexHash[:2], hexHash[2:])
+}
+
+// PublishCAS : contentをblockSize毎に分割し、各ブロックを強チェックサムの名前で
+// dir以下にContent-Addressed Storageとして書き出す
+func PublishCAS(content io.Reader, fileSize int64, blockSize uint, dir string) ([]ManifestEntry, error) {
+	var manifest []ManifestEntry
+	buf := make([]byte, blockSize)
+
+	for index := uint(0); ; index++ {
+		n, err := io.ReadFull(content, buf)
+		if n == 0 {
+			break
+		}
+		if err != nil && err != io.ErrUnexpectedEOF && err != io.EOF {
+			return nil, err
+		}
+
+		block := buf[:n]
+		strongHash := md5.Sum(block)
+
+		path := casObjectPath(dir, strongHash[:])
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			return nil, err
+		}
+		if err := ioutil.WriteFile(path, block, 0644); err != nil {
+			return nil, err
+		}
+
+		manifest = append(manifest, ManifestEntry{Index: index, StrongHash: strongHash[:]})
+
+		if err == io.ErrUnexpectedEOF || err == io.EOF || uint(n) < blockSize {
+			break
+		}
+	}
+
+	return manifest, nil
+}
+
+// casObjectHandler : PublishCASが書き出したディレクトリからブロック本体を配信するハンドラ
+//
+// リクエストパスは /<hex-strong-hash> もしくは /<ab>/<cdef...> の2階層ファンアウトを受け付ける
+func casObjectHandler(dir string) http.HandlerFunc {
+	cleanDir := filepath.Clean(dir)
+
+	return func(w http.ResponseWriter, req *http.Request) {
+		rel := strings.TrimPrefix(req.URL.Path, "/")
+		path := filepath.Join(cleanDir, filepath.FromSlash(rel))
+
+		if path != cleanDir && !strings.HasPrefix(path, cleanDir+string(filepath.Separator)) {
+			http.NotFound(w, req)
+			return
+		}
+
+		http.ServeFile(w, req, path)
+	}
+}
+
+// ContentAddressedSource : バイト範囲ではなく強チェックサムをキーにブロック本体を
+// 取得するRequester。ブロックサイズ境界に整列したstart/endから対象ブロックの
+// インデックスを求め、マニフェストから強チェックサムを引いてオブジェクトを取りに行く。
+type ContentAddressedSource struct {
+	BaseURL   string
+	Client    *http.Client
+	BlockSize uint64
+	Lookup    filechecksum.ChecksumLookup
+}
+
+// DoRequest : [start, end)が属するブロックの強チェックサムをLookupで引き、
+// BaseURL/<fanout>からその内容を取得する
+func (c *ContentAddressedSource) DoRequest(start int64, end int64) ([]byte, error) {
+	blockIndex := uint(start / int64(c.BlockSize))
+
+	strongHash := c.Lookup.GetStrongChecksumForBlock(int(blockIndex))
+	if strongHash == nil {
+		return nil, fmt.Errorf("no strong checksum known for block %v", blockIndex)
+	}
+
+	hexHash := hex.EncodeToString(strongHash)
+	var url string
+	if len(hexHash) > 2 {
+		url = fmt.Sprintf("%s/%s/%s", c.BaseURL, hexHash[:2], hexHash[2:])
+	} else {
+		url = fmt.Sprintf("%s/%s", c.BaseURL, hexHash)
+	}
+
+	client := c.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+
+	resp, err := client.Get(url)
+	if err != nil {
+		return nil, err
+	}
+
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("unexpected status fetching block %v: %v", blockIndex, resp.Status)
+	}
+
+	return ioutil.ReadAll(resp.Body)
+}
+
+// IsFatal : CASオブジェクトの取得に失敗した場合はBlockSourceBaseに諦めさせる
+func (c *ContentAddressedSource) IsFatal(err error) bool {
+	return true
+}
+
+// MakeCASRSync : Content-Addressed Storageからブロックを取得するgosync.RSyncを作成する
+func MakeCASRSync(local gosync.ReadSeekerAt, baseURL string, output io.Writer, fs gosync.FileSummary) *gosync.RSync {
+	return &gosync.RSync{
+		Input:  local,
+		Output: output,
+		Source: blocksources.NewBlockSourceBase(
+			&ContentAddressedSource{
+				BaseURL:   baseURL,
+				BlockSize: uint64(fs.GetBlockSize()),
+				Lookup:    fs,
+			},
+			blocksources.MakeFileSizedBlockResolver(
+				uint64(fs.GetBlockSize()),
+				fs.GetFileSize(),
+			),
+			&filechecksum.HashVerifier{
+				Hash:                md5.New(),
+				BlockSize:           fs.GetBlockSize(),
+				BlockChecksumGetter: fs,
+			},
+			1,
+			4*MB,
+		),
+		Summary: fs,
+		OnClose: nil,
+	}
+}
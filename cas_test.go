@@ -0,0 +1,133 @@
+package main
+
+import (
+	"bytes"
+	"encoding/hex"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestPublishCASAndEncodeChecksumIndexWithManifestAgree(t *testing.T) {
+	content := []byte("The quick brown fox jumped over the lazy dog")
+	const blockSize = 4
+
+	dir, err := ioutil.TempDir("", "cas-publish")
+	if err != nil {
+		t.Fatalf("TempDir failed: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	published, err := PublishCAS(bytes.NewReader(content), int64(len(content)), blockSize, dir)
+	if err != nil {
+		t.Fatalf("PublishCAS failed: %v", err)
+	}
+
+	_, manifest, err := EncodeChecksumIndexWithManifest(bytes.NewReader(content), int64(len(content)), blockSize)
+	if err != nil {
+		t.Fatalf("EncodeChecksumIndexWithManifest failed: %v", err)
+	}
+
+	if len(published) != len(manifest) {
+		t.Fatalf("PublishCAS produced %d blocks, EncodeChecksumIndexWithManifest produced %d", len(published), len(manifest))
+	}
+
+	for i := range manifest {
+		if !bytes.Equal(published[i].StrongHash, manifest[i].StrongHash) {
+			t.Errorf("block %d: PublishCAS hash %x != manifest hash %x", i, published[i].StrongHash, manifest[i].StrongHash)
+		}
+
+		path := casObjectPath(dir, manifest[i].StrongHash)
+		data, err := ioutil.ReadFile(path)
+		if err != nil {
+			t.Fatalf("block %d: could not read published object at %s: %v", i, path, err)
+		}
+
+		start := i * blockSize
+		end := start + blockSize
+		if end > len(content) {
+			end = len(content)
+		}
+
+		if !bytes.Equal(data, content[start:end]) {
+			t.Errorf("block %d: published object content = %q, want %q", i, data, content[start:end])
+		}
+	}
+}
+
+func TestCasObjectHandlerServesPublishedBlock(t *testing.T) {
+	content := []byte("The quick brown fox jumped over the lazy dog")
+	const blockSize = 4
+
+	dir, err := ioutil.TempDir("", "cas-serve")
+	if err != nil {
+		t.Fatalf("TempDir failed: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	manifest, err := PublishCAS(bytes.NewReader(content), int64(len(content)), blockSize, dir)
+	if err != nil {
+		t.Fatalf("PublishCAS failed: %v", err)
+	}
+
+	handler := casObjectHandler(dir)
+	server := httptest.NewServer(handler)
+	defer server.Close()
+
+	hexHash := hex.EncodeToString(manifest[0].StrongHash)
+	resp, err := http.Get(server.URL + "/" + hexHash[:2] + "/" + hexHash[2:])
+	if err != nil {
+		t.Fatalf("GET failed: %v", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("status = %d, want 200", resp.StatusCode)
+	}
+
+	body, _ := ioutil.ReadAll(resp.Body)
+	if !bytes.Equal(body, content[0:blockSize]) {
+		t.Errorf("body = %q, want %q", body, content[0:blockSize])
+	}
+}
+
+func TestCasObjectHandlerRejectsPathTraversal(t *testing.T) {
+	dir, err := ioutil.TempDir("", "cas-traversal")
+	if err != nil {
+		t.Fatalf("TempDir failed: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	// A secret file living next to (not inside) the CAS dir, and a sibling
+	// directory that shares dir's name as a prefix (e.g. "dir" vs "dir-public").
+	secret := filepath.Join(filepath.Dir(dir), "secret.txt")
+	if err := ioutil.WriteFile(secret, []byte("do not serve me"), 0644); err != nil {
+		t.Fatalf("WriteFile failed: %v", err)
+	}
+	defer os.Remove(secret)
+
+	handler := casObjectHandler(dir)
+	server := httptest.NewServer(handler)
+	defer server.Close()
+
+	paths := []string{
+		"/../" + filepath.Base(secret),
+		"/..%2f" + filepath.Base(secret),
+	}
+
+	for _, p := range paths {
+		resp, err := http.Get(server.URL + p)
+		if err != nil {
+			t.Fatalf("GET %s failed: %v", p, err)
+		}
+		body, _ := ioutil.ReadAll(resp.Body)
+		resp.Body.Close()
+
+		if resp.StatusCode == http.StatusOK && bytes.Contains(body, []byte("do not serve me")) {
+			t.Errorf("GET %s leaked file outside CAS dir: %q", p, body)
+		}
+	}
+}
@@ -0,0 +1,75 @@
+package main
+
+import (
+	"container/list"
+	"sync"
+)
+
+// checksumCacheKey : キャッシュの一意キー。ファイルが変わったかどうかを
+// path + mtime + size + blockSizeで判定する
+type checksumCacheKey struct {
+	path      string
+	mtime     int64
+	size      int64
+	blockSize uint
+}
+
+// ChecksumCache : (path, mtime, size, blockSize)をキーにエンコード済みの
+// チェックサムインデックスをキャッシュするLRU
+type ChecksumCache struct {
+	mu       sync.Mutex
+	capacity int
+	ll       *list.List
+	items    map[checksumCacheKey]*list.Element
+}
+
+type checksumCacheEntry struct {
+	key   checksumCacheKey
+	value []byte
+}
+
+// NewChecksumCache : 最大capacity件を保持するChecksumCacheを作る
+func NewChecksumCache(capacity int) *ChecksumCache {
+	return &ChecksumCache{
+		capacity: capacity,
+		ll:       list.New(),
+		items:    make(map[checksumCacheKey]*list.Element),
+	}
+}
+
+// Get : キーに対応するキャッシュ済みバイト列を返す
+func (c *ChecksumCache) Get(key checksumCacheKey) ([]byte, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	elem, ok := c.items[key]
+	if !ok {
+		return nil, false
+	}
+
+	c.ll.MoveToFront(elem)
+	return elem.Value.(*checksumCacheEntry).value, true
+}
+
+// Add : キーとバイト列をキャッシュに追加する。容量を超えたら最も古いエントリを捨てる
+func (c *ChecksumCache) Add(key checksumCacheKey, value []byte) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if elem, ok := c.items[key]; ok {
+		c.ll.MoveToFront(elem)
+		elem.Value.(*checksumCacheEntry).value = value
+		return
+	}
+
+	elem := c.ll.PushFront(&checksumCacheEntry{key: key, value: value})
+	c.items[key] = elem
+
+	if c.capacity > 0 && c.ll.Len() > c.capacity {
+		oldest := c.ll.Back()
+		if oldest != nil {
+			c.ll.Remove(oldest)
+			delete(c.items, oldest.Value.(*checksumCacheEntry).key)
+		}
+	}
+}
@@ -0,0 +1,83 @@
+package main
+
+import (
+	"testing"
+)
+
+func TestChecksumCacheGetMissAndHit(t *testing.T) {
+	cache := NewChecksumCache(2)
+	key := checksumCacheKey{path: "a.txt", mtime: 1, size: 10, blockSize: 4}
+
+	if _, ok := cache.Get(key); ok {
+		t.Fatalf("Get on empty cache returned a hit")
+	}
+
+	cache.Add(key, []byte("data-a"))
+
+	value, ok := cache.Get(key)
+	if !ok {
+		t.Fatalf("Get after Add returned a miss")
+	}
+	if string(value) != "data-a" {
+		t.Errorf("Get returned %q, want %q", value, "data-a")
+	}
+}
+
+func TestChecksumCacheEvictsLeastRecentlyUsed(t *testing.T) {
+	cache := NewChecksumCache(2)
+
+	keyA := checksumCacheKey{path: "a.txt", mtime: 1, size: 10, blockSize: 4}
+	keyB := checksumCacheKey{path: "b.txt", mtime: 1, size: 10, blockSize: 4}
+	keyC := checksumCacheKey{path: "c.txt", mtime: 1, size: 10, blockSize: 4}
+
+	cache.Add(keyA, []byte("a"))
+	cache.Add(keyB, []byte("b"))
+
+	// Touch A so B becomes the least recently used entry.
+	if _, ok := cache.Get(keyA); !ok {
+		t.Fatalf("Get(keyA) returned a miss")
+	}
+
+	// Adding a third entry at capacity 2 should evict B, not A.
+	cache.Add(keyC, []byte("c"))
+
+	if _, ok := cache.Get(keyB); ok {
+		t.Errorf("Get(keyB) returned a hit, want evicted")
+	}
+
+	if _, ok := cache.Get(keyA); !ok {
+		t.Errorf("Get(keyA) returned a miss, want hit (should not have been evicted)")
+	}
+
+	if _, ok := cache.Get(keyC); !ok {
+		t.Errorf("Get(keyC) returned a miss, want hit")
+	}
+}
+
+func TestChecksumCacheAddExistingKeyRefreshesRecency(t *testing.T) {
+	cache := NewChecksumCache(2)
+
+	keyA := checksumCacheKey{path: "a.txt", mtime: 1, size: 10, blockSize: 4}
+	keyB := checksumCacheKey{path: "b.txt", mtime: 1, size: 10, blockSize: 4}
+	keyC := checksumCacheKey{path: "c.txt", mtime: 1, size: 10, blockSize: 4}
+
+	cache.Add(keyA, []byte("a"))
+	cache.Add(keyB, []byte("b"))
+
+	// Re-adding A (e.g. a refreshed checksum for the same file) should count
+	// as a use, making B the eviction candidate instead.
+	cache.Add(keyA, []byte("a-updated"))
+	cache.Add(keyC, []byte("c"))
+
+	if _, ok := cache.Get(keyB); ok {
+		t.Errorf("Get(keyB) returned a hit, want evicted")
+	}
+
+	value, ok := cache.Get(keyA)
+	if !ok {
+		t.Fatalf("Get(keyA) returned a miss, want hit")
+	}
+	if string(value) != "a-updated" {
+		t.Errorf("Get(keyA) = %q, want %q", value, "a-updated")
+	}
+}
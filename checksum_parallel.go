@@ -0,0 +1,108 @@
+package main
+
+import (
+	"bytes"
+	"io"
+	"runtime"
+	"sync"
+
+	"github.com/Redundancy/go-sync/filechecksum"
+)
+
+// EncodeChecksumIndexParallel : EncodeChecksumIndexと同じフォーマットで出力するが、
+// ファイルをblockSize境界でN分割し、シャードごとに並列でチェックサムを計算する。
+// 分割結果はブロック順に結合されるため出力はシングルスレッド版と完全に一致する。
+func EncodeChecksumIndexParallel(content io.ReaderAt, fileSize int64, blockSize uint) (io.ReadSeeker, error) {
+	generator := filechecksum.NewFileChecksumGenerator(blockSize)
+	weakSize := generator.WeakRollingHash.Size()
+	strongSize := generator.GetStrongHash().Size()
+
+	table, err := generateChecksumsParallel(content, fileSize, blockSize, runtime.NumCPU())
+	if err != nil {
+		return nil, err
+	}
+
+	b := bytes.NewBuffer(nil)
+	b.Write(int64ToBytes(fileSize))
+	b.Write(intToBytes(weakSize))
+	b.Write(intToBytes(strongSize))
+	b.Write(table)
+
+	return bytes.NewReader(b.Bytes()), nil
+}
+
+// generateChecksumsParallel : blockSize単位でfileSizeをworkers個のシャードに分け、
+// 各シャードをgoroutineでハッシュしてブロック順に結合したバイト列を返す
+func generateChecksumsParallel(content io.ReaderAt, fileSize int64, blockSize uint, workers int) ([]byte, error) {
+	if workers < 1 {
+		workers = 1
+	}
+
+	blockCount := fileSize / int64(blockSize)
+	if fileSize%int64(blockSize) != 0 {
+		blockCount++
+	}
+
+	if blockCount == 0 {
+		return nil, nil
+	}
+
+	if int64(workers) > blockCount {
+		workers = int(blockCount)
+	}
+
+	shardBlocks := (blockCount + int64(workers) - 1) / int64(workers)
+	shards := make([][]byte, workers)
+
+	var wg sync.WaitGroup
+	errs := make([]error, workers)
+
+	for i := 0; i < workers; i++ {
+		startBlock := int64(i) * shardBlocks
+		if startBlock >= blockCount {
+			continue
+		}
+
+		endBlock := startBlock + shardBlocks
+		if endBlock > blockCount {
+			endBlock = blockCount
+		}
+
+		offset := startBlock * int64(blockSize)
+		length := (endBlock - startBlock) * int64(blockSize)
+		if offset+length > fileSize {
+			length = fileSize - offset
+		}
+
+		wg.Add(1)
+		go func(i int, offset, length int64) {
+			defer wg.Done()
+
+			sr := io.NewSectionReader(content, offset, length)
+			generator := filechecksum.NewFileChecksumGenerator(blockSize)
+			buf := bytes.NewBuffer(nil)
+
+			if _, err := generator.GenerateChecksums(sr, buf); err != nil {
+				errs[i] = err
+				return
+			}
+
+			shards[i] = buf.Bytes()
+		}(i, offset, length)
+	}
+
+	wg.Wait()
+
+	for _, err := range errs {
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	out := bytes.NewBuffer(nil)
+	for _, shard := range shards {
+		out.Write(shard)
+	}
+
+	return out.Bytes(), nil
+}
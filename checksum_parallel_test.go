@@ -0,0 +1,66 @@
+package main
+
+import (
+	"bytes"
+	"io/ioutil"
+	"testing"
+)
+
+func TestEncodeChecksumIndexParallelMatchesSingleThreaded(t *testing.T) {
+	content := bytes.Repeat([]byte("The quick brown fox jumped over the lazy dog. "), 50)
+
+	for _, blockSize := range []uint{4, 7, 64} {
+		serial, err := EncodeChecksumIndex(bytes.NewReader(content), int64(len(content)), blockSize)
+		if err != nil {
+			t.Fatalf("[blockSize=%d] EncodeChecksumIndex failed: %v", blockSize, err)
+		}
+
+		serialBytes, err := ioutil.ReadAll(serial)
+		if err != nil {
+			t.Fatalf("[blockSize=%d] ReadAll(serial) failed: %v", blockSize, err)
+		}
+
+		parallel, err := EncodeChecksumIndexParallel(bytes.NewReader(content), int64(len(content)), blockSize)
+		if err != nil {
+			t.Fatalf("[blockSize=%d] EncodeChecksumIndexParallel failed: %v", blockSize, err)
+		}
+
+		parallelBytes, err := ioutil.ReadAll(parallel)
+		if err != nil {
+			t.Fatalf("[blockSize=%d] ReadAll(parallel) failed: %v", blockSize, err)
+		}
+
+		if !bytes.Equal(serialBytes, parallelBytes) {
+			t.Errorf("[blockSize=%d] parallel output does not match serial output byte-for-byte", blockSize)
+		}
+	}
+}
+
+func TestEncodeChecksumIndexParallelEmptyContent(t *testing.T) {
+	content := []byte{}
+	const blockSize = 4
+
+	serial, err := EncodeChecksumIndex(bytes.NewReader(content), 0, blockSize)
+	if err != nil {
+		t.Fatalf("EncodeChecksumIndex failed: %v", err)
+	}
+
+	serialBytes, err := ioutil.ReadAll(serial)
+	if err != nil {
+		t.Fatalf("ReadAll(serial) failed: %v", err)
+	}
+
+	parallel, err := EncodeChecksumIndexParallel(bytes.NewReader(content), 0, blockSize)
+	if err != nil {
+		t.Fatalf("EncodeChecksumIndexParallel failed: %v", err)
+	}
+
+	parallelBytes, err := ioutil.ReadAll(parallel)
+	if err != nil {
+		t.Fatalf("ReadAll(parallel) failed: %v", err)
+	}
+
+	if !bytes.Equal(serialBytes, parallelBytes) {
+		t.Errorf("parallel output does not match serial output for empty content")
+	}
+}
@@ -0,0 +1,203 @@
+package main
+
+import (
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/golang/snappy"
+)
+
+// ErrRangeNotSingleBlock : 要求されたバイト範囲がちょうど1ブロック分ではない場合のエラー
+var ErrRangeNotSingleBlock = fmt.Errorf("requested range does not match exactly one block")
+
+// EncGzip, EncSnappy : サーバが広告する/クライアントが要求する圧縮方式
+const (
+	EncGzip   = "gzip"
+	EncSnappy = "snappy"
+)
+
+// withEncQueryParam : リクエストURLに?enc=<enc>を追加する
+func withEncQueryParam(rawURL string, enc string) string {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return rawURL
+	}
+
+	q := u.Query()
+	q.Set("enc", enc)
+	u.RawQuery = q.Encode()
+
+	return u.String()
+}
+
+// decompressBytes : Content-Encodingに応じて既に読み切ったレスポンスボディを
+// 透過的に展開する。圧縮が指定されていなければそのまま返す。
+func decompressBytes(data []byte, encoding string) ([]byte, error) {
+	switch encoding {
+	case EncGzip:
+		gr, err := gzip.NewReader(bytes.NewReader(data))
+		if err != nil {
+			return nil, err
+		}
+		defer gr.Close()
+
+		return ioutil.ReadAll(gr)
+	case EncSnappy:
+		return snappy.Decode(nil, data)
+	default:
+		return data, nil
+	}
+}
+
+// compressBlock : 1ブロック分のバイト列をencで圧縮する。encが空ならそのまま返す
+func compressBlock(enc string, block []byte) ([]byte, error) {
+	switch enc {
+	case EncGzip:
+		buf := bytes.NewBuffer(nil)
+		gw := gzip.NewWriter(buf)
+		if _, err := gw.Write(block); err != nil {
+			return nil, err
+		}
+		if err := gw.Close(); err != nil {
+			return nil, err
+		}
+		return buf.Bytes(), nil
+	case EncSnappy:
+		return snappy.Encode(nil, block), nil
+	default:
+		return block, nil
+	}
+}
+
+// BlockOffset : 圧縮済みsidecarファイル中でのブロックの位置とサイズ、および
+// 展開後(元コンテンツ上)のバイト長
+type BlockOffset struct {
+	Offset             int64
+	Length             int64
+	UncompressedLength int64
+}
+
+// BuildCompressedSidecar : contentをblockSize単位に分割してencで個別に圧縮し、
+// sidecarPathへ連結して書き出す。戻り値のインデックスを引けばブロックNの
+// 圧縮バイト列へO(1)でシークできる。
+func BuildCompressedSidecar(content io.Reader, blockSize uint, enc string, sidecarPath string) ([]BlockOffset, error) {
+	out, err := os.Create(sidecarPath)
+	if err != nil {
+		return nil, err
+	}
+	defer out.Close()
+
+	var index []BlockOffset
+	var offset int64
+	buf := make([]byte, blockSize)
+
+	for {
+		n, readErr := io.ReadFull(content, buf)
+		if n == 0 {
+			break
+		}
+		if readErr != nil && readErr != io.ErrUnexpectedEOF && readErr != io.EOF {
+			return nil, readErr
+		}
+
+		compressed, err := compressBlock(enc, buf[:n])
+		if err != nil {
+			return nil, err
+		}
+
+		if _, err := out.Write(compressed); err != nil {
+			return nil, err
+		}
+
+		index = append(index, BlockOffset{
+			Offset:             offset,
+			Length:             int64(len(compressed)),
+			UncompressedLength: int64(n),
+		})
+		offset += int64(len(compressed))
+
+		if readErr == io.ErrUnexpectedEOF || readErr == io.EOF || uint(n) < blockSize {
+			break
+		}
+	}
+
+	return index, nil
+}
+
+// compressedContentHandler : BuildCompressedSidecarが書き出したsidecarから、
+// Rangeヘッダ(ブロック境界に整列した元コンテンツ基準のバイト範囲)に対応する
+// 圧縮済みブロックをシークして返す。元ファイル全体を都度圧縮し直す必要はない。
+func compressedContentHandler(sidecarPath string, index []BlockOffset, blockSize uint, enc string) http.HandlerFunc {
+	return func(w http.ResponseWriter, req *http.Request) {
+		start, end, err := parseRangeHeader(req.Header.Get("Range"))
+		if err != nil {
+			http.Error(w, "invalid range", http.StatusBadRequest)
+			return
+		}
+
+		blockIndex := int(start / int64(blockSize))
+		if blockIndex < 0 || blockIndex >= len(index) {
+			http.NotFound(w, req)
+			return
+		}
+
+		entry := index[blockIndex]
+
+		// parseRangeHeaderはHTTPのRangeの慣習(終端を含む)で値を返すため、
+		// [start, end)に揃えてからブロック境界ぴったりかを確認する。
+		requestedLength := end - start + 1
+		if start != int64(blockIndex)*int64(blockSize) || requestedLength != entry.UncompressedLength {
+			http.Error(w, ErrRangeNotSingleBlock.Error(), http.StatusRequestedRangeNotSatisfiable)
+			return
+		}
+
+		sidecar, err := os.Open(sidecarPath)
+		if err != nil {
+			http.NotFound(w, req)
+			return
+		}
+		defer sidecar.Close()
+
+		if _, err := sidecar.Seek(entry.Offset, io.SeekStart); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Encoding", enc)
+		w.WriteHeader(http.StatusPartialContent)
+		io.CopyN(w, sidecar, entry.Length)
+	}
+}
+
+// parseRangeHeader : "bytes=start-end" 形式のRangeヘッダをパースする
+func parseRangeHeader(header string) (start int64, end int64, err error) {
+	const prefix = "bytes="
+	if !strings.HasPrefix(header, prefix) {
+		return 0, 0, fmt.Errorf("unsupported range header: %q", header)
+	}
+
+	parts := strings.SplitN(strings.TrimPrefix(header, prefix), "-", 2)
+	if len(parts) != 2 {
+		return 0, 0, fmt.Errorf("malformed range header: %q", header)
+	}
+
+	start, err = strconv.ParseInt(parts[0], 10, 64)
+	if err != nil {
+		return 0, 0, err
+	}
+
+	end, err = strconv.ParseInt(parts[1], 10, 64)
+	if err != nil {
+		return 0, 0, err
+	}
+
+	return start, end, nil
+}
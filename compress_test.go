@@ -0,0 +1,163 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestCompressBlockDecompressBytesRoundTrip(t *testing.T) {
+	block := []byte("The quick brown fox jumped over the lazy dog")
+
+	for _, enc := range []string{EncGzip, EncSnappy, ""} {
+		compressed, err := compressBlock(enc, block)
+		if err != nil {
+			t.Fatalf("[%s] compressBlock failed: %v", enc, err)
+		}
+
+		decompressed, err := decompressBytes(compressed, enc)
+		if err != nil {
+			t.Fatalf("[%s] decompressBytes failed: %v", enc, err)
+		}
+
+		if !bytes.Equal(decompressed, block) {
+			t.Errorf("[%s] decompressBytes(compressBlock(block)) = %q, want %q", enc, decompressed, block)
+		}
+	}
+}
+
+func TestBuildCompressedSidecarRoundTrip(t *testing.T) {
+	content := []byte("The quick brown fox jumped over the lazy dog")
+	const blockSize = 4
+
+	for _, enc := range []string{EncGzip, EncSnappy} {
+		sidecarPath, cleanup := tempFilePath(t, "compress-sidecar")
+		defer cleanup()
+
+		index, err := BuildCompressedSidecar(bytes.NewReader(content), blockSize, enc, sidecarPath)
+		if err != nil {
+			t.Fatalf("[%s] BuildCompressedSidecar failed: %v", enc, err)
+		}
+
+		sidecar, err := ioutil.ReadFile(sidecarPath)
+		if err != nil {
+			t.Fatalf("[%s] ReadFile failed: %v", enc, err)
+		}
+
+		var reconstructed []byte
+		for i, entry := range index {
+			start := i * blockSize
+			end := start + blockSize
+			if end > len(content) {
+				end = len(content)
+			}
+
+			compressed := sidecar[entry.Offset : entry.Offset+entry.Length]
+			block, err := decompressBytes(compressed, enc)
+			if err != nil {
+				t.Fatalf("[%s] block %d: decompressBytes failed: %v", enc, i, err)
+			}
+
+			if int64(len(block)) != entry.UncompressedLength {
+				t.Errorf("[%s] block %d: UncompressedLength = %d, want %d", enc, i, entry.UncompressedLength, len(block))
+			}
+
+			reconstructed = append(reconstructed, block...)
+
+			if end-start != len(block) {
+				t.Errorf("[%s] block %d: decompressed length = %d, want %d", enc, i, len(block), end-start)
+			}
+		}
+
+		if !bytes.Equal(reconstructed, content) {
+			t.Errorf("[%s] reconstructed content = %q, want %q", enc, reconstructed, content)
+		}
+	}
+}
+
+func TestCompressedContentHandlerServesSingleBlock(t *testing.T) {
+	content := []byte("The quick brown fox jumped over the lazy dog")
+	const blockSize = 4
+	const enc = EncGzip
+
+	sidecarPath, cleanup := tempFilePath(t, "compress-handler-sidecar")
+	defer cleanup()
+
+	index, err := BuildCompressedSidecar(bytes.NewReader(content), blockSize, enc, sidecarPath)
+	if err != nil {
+		t.Fatalf("BuildCompressedSidecar failed: %v", err)
+	}
+
+	handler := compressedContentHandler(sidecarPath, index, blockSize, enc)
+	server := httptest.NewServer(handler)
+	defer server.Close()
+
+	req, err := http.NewRequest("GET", server.URL, nil)
+	if err != nil {
+		t.Fatalf("NewRequest failed: %v", err)
+	}
+	req.Header.Set("Range", fmt.Sprintf("bytes=%d-%d", 0, blockSize-1))
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("Do failed: %v", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusPartialContent {
+		t.Fatalf("status = %d, want %d", resp.StatusCode, http.StatusPartialContent)
+	}
+
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatalf("ReadAll failed: %v", err)
+	}
+
+	decoded, err := decompressBytes(body, enc)
+	if err != nil {
+		t.Fatalf("decompressBytes failed: %v", err)
+	}
+
+	if !bytes.Equal(decoded, content[0:blockSize]) {
+		t.Errorf("decoded body = %q, want %q", decoded, content[0:blockSize])
+	}
+}
+
+func TestCompressedContentHandlerRejectsRangeWiderThanOneBlock(t *testing.T) {
+	content := []byte("The quick brown fox jumped over the lazy dog")
+	const blockSize = 4
+	const enc = EncSnappy
+
+	sidecarPath, cleanup := tempFilePath(t, "compress-handler-wide-sidecar")
+	defer cleanup()
+
+	index, err := BuildCompressedSidecar(bytes.NewReader(content), blockSize, enc, sidecarPath)
+	if err != nil {
+		t.Fatalf("BuildCompressedSidecar failed: %v", err)
+	}
+
+	handler := compressedContentHandler(sidecarPath, index, blockSize, enc)
+	server := httptest.NewServer(handler)
+	defer server.Close()
+
+	// Request a range that spans two blocks; the handler must not silently
+	// truncate to a single block's worth of data.
+	req, err := http.NewRequest("GET", server.URL, nil)
+	if err != nil {
+		t.Fatalf("NewRequest failed: %v", err)
+	}
+	req.Header.Set("Range", fmt.Sprintf("bytes=%d-%d", 0, 2*blockSize-1))
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("Do failed: %v", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusRequestedRangeNotSatisfiable {
+		t.Fatalf("status = %d, want %d", resp.StatusCode, http.StatusRequestedRangeNotSatisfiable)
+	}
+}
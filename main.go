@@ -83,6 +83,10 @@ func contentHandler(w http.ResponseWriter, req *http.Request) {
 	http.ServeFile(w, req, "remote.txt")
 }
 
+// checksumCache : checksumHandlerが(path, mtime, size, blockSize)をキーに
+// エンコード済みチェックサムインデックスを使い回すためのキャッシュ
+var checksumCache = NewChecksumCache(16)
+
 // チェックサムダウンロードのハンドラ
 func checksumHandler(w http.ResponseWriter, req *http.Request) {
 	var blockSize uint64 = 1024 * 1024
@@ -102,13 +106,31 @@ func checksumHandler(w http.ResponseWriter, req *http.Request) {
 		return
 	}
 
-	b, err := EncodeChecksumIndex(remote, info.Size(), uint(blockSize))
-	if err != nil {
-		http.NotFound(w, req)
-		return
+	key := checksumCacheKey{
+		path:      "remote.txt",
+		mtime:     info.ModTime().UnixNano(),
+		size:      info.Size(),
+		blockSize: uint(blockSize),
+	}
+
+	data, ok := checksumCache.Get(key)
+	if !ok {
+		b, err := EncodeChecksumIndexParallel(remote, info.Size(), uint(blockSize))
+		if err != nil {
+			http.NotFound(w, req)
+			return
+		}
+
+		data, err = ioutil.ReadAll(b)
+		if err != nil {
+			http.NotFound(w, req)
+			return
+		}
+
+		checksumCache.Add(key, data)
 	}
 
-	http.ServeContent(w, req, "", time.Now(), b)
+	http.ServeContent(w, req, "", time.Now(), bytes.NewReader(data))
 }
 
 // EncodeChecksumIndex : gosyncのChecksumIndexをエンコードする
@@ -222,6 +244,33 @@ func MakeRSync(local gosync.ReadSeekerAt, remote string, output io.Writer, fs go
 	}
 }
 
+// MakeParallelRSync : 複数ミラーに対して並列にブロックを取得するgosync.RSyncを作成する
+//
+// MakeRSyncが単一のHttpRequesterを並行数1で使うのに対し、こちらはMultiRequesterで
+// N本の接続を使い分け、concurrentに指定した数だけ同時にブロックを取得する。
+func MakeParallelRSync(local gosync.ReadSeekerAt, mirrors []string, output io.Writer, fs gosync.FileSummary, concurrent int) *gosync.RSync {
+	return &gosync.RSync{
+		Input:  local,
+		Output: output,
+		Source: blocksources.NewBlockSourceBase(
+			NewMultiRequester(mirrors, http.DefaultClient),
+			blocksources.MakeFileSizedBlockResolver(
+				uint64(fs.GetBlockSize()),
+				fs.GetFileSize(),
+			),
+			&filechecksum.HashVerifier{
+				Hash:                md5.New(),
+				BlockSize:           fs.GetBlockSize(),
+				BlockChecksumGetter: fs,
+			},
+			concurrent,
+			4*MB,
+		),
+		Summary: fs,
+		OnClose: nil,
+	}
+}
+
 // helpers
 func intToBytes(val int) []byte {
 	bs := make([]byte, 4)
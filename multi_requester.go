@@ -0,0 +1,90 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"sync/atomic"
+	"time"
+)
+
+// MultiRequester : 複数のHttpRequester(ミラー)にリクエストを分散させる
+// blocksources.BlockSourceRequester
+//
+// 1本のHTTP接続だけではbandwidth-latency productを使い切れないケースに対応するため、
+// ミラーURLのプールに対してラウンドロビンでリクエストを振り分け、失敗したミラーは
+// バックオフの後に別のミラーへフォールバックする。隣接するブロック範囲を1つの
+// Rangeリクエストにまとめる処理は、これを使うBlockSourceBase自身が
+// BlockSourceOffsetResolver.SplitBlockRangeToDesiredSizeで既に行っているため、
+// MultiRequesterはミラー選択とリトライにのみ責務を絞っている。
+type MultiRequester struct {
+	Requesters []*HttpRequester
+	MaxRetries int
+	Backoff    time.Duration
+
+	next uint32
+}
+
+// NewMultiRequester : ミラーURLのリストからMultiRequesterを作る
+func NewMultiRequester(urls []string, client *http.Client) *MultiRequester {
+	requesters := make([]*HttpRequester, len(urls))
+	for i, u := range urls {
+		requesters[i] = &HttpRequester{Url: u, Client: client}
+	}
+
+	return &MultiRequester{
+		Requesters: requesters,
+		MaxRetries: 3,
+		Backoff:    100 * time.Millisecond,
+	}
+}
+
+// DoRequest : [start, end)のバイト範囲を、ミラーを切り替えながら取得する
+func (m *MultiRequester) DoRequest(start int64, end int64) (data []byte, err error) {
+	if len(m.Requesters) == 0 {
+		return nil, fmt.Errorf("no requesters configured")
+	}
+
+	maxAttempts := len(m.Requesters) * m.retries()
+	var lastErr error
+
+	for attempt := 0; attempt < maxAttempts; attempt++ {
+		r := m.pick()
+
+		data, err = r.DoRequest(start, end)
+		if err == nil {
+			return data, nil
+		}
+
+		lastErr = fmt.Errorf("requester %v failed: %w", r.Url, err)
+
+		if attempt < maxAttempts-1 {
+			time.Sleep(m.backoff(attempt))
+		}
+	}
+
+	return nil, lastErr
+}
+
+// IsFatal : ミラーを一巡してもなお失敗する場合はBlockSourceBaseに諦めさせる
+func (m *MultiRequester) IsFatal(err error) bool {
+	return true
+}
+
+func (m *MultiRequester) retries() int {
+	if m.MaxRetries <= 0 {
+		return 1
+	}
+	return m.MaxRetries
+}
+
+func (m *MultiRequester) backoff(attempt int) time.Duration {
+	if m.Backoff <= 0 {
+		return 0
+	}
+	return m.Backoff * time.Duration(attempt+1)
+}
+
+func (m *MultiRequester) pick() *HttpRequester {
+	n := atomic.AddUint32(&m.next, 1)
+	return m.Requesters[int(n)%len(m.Requesters)]
+}
@@ -0,0 +1,64 @@
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net/http"
+)
+
+// MB : 1メガバイトのバイト数
+const MB = 1024 * 1024
+
+// HttpRequester : HTTP Rangeリクエストでブロックを取得するblocksources.BlockSourceRequester
+//
+// Encに"gzip"または"snappy"を設定すると、サーバへのリクエストに?enc=を付け、
+// サーバが返すContent-Encodingに応じてブロック本体を透過的に展開してから返す。
+type HttpRequester struct {
+	Url    string
+	Client *http.Client
+	Enc    string
+}
+
+// DoRequest : [start, end)のバイト範囲をHTTP Rangeリクエストで取得する
+func (r *HttpRequester) DoRequest(start int64, end int64) (data []byte, err error) {
+	url := r.Url
+	if r.Enc != "" {
+		url = withEncQueryParam(url, r.Enc)
+	}
+
+	req, err := http.NewRequest("GET", url, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	req.Header.Set("Range", fmt.Sprintf("bytes=%d-%d", start, end-1))
+
+	client := r.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusPartialContent && resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("unexpected status requesting %v: %v", r.Url, resp.Status)
+	}
+
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+
+	return decompressBytes(body, resp.Header.Get("Content-Encoding"))
+}
+
+// IsFatal : HttpRequesterのエラーはBlockSourceBaseに別のリクエストとして
+// リトライさせず、そのまま失敗として扱う
+func (r *HttpRequester) IsFatal(err error) bool {
+	return true
+}
@@ -0,0 +1,289 @@
+package main
+
+import (
+	"encoding/binary"
+	"hash/crc32"
+	"io"
+	"io/ioutil"
+	"os"
+
+	gosync "github.com/Redundancy/go-sync"
+)
+
+// blockState : journal上の各ブロックの状態
+type blockState byte
+
+const (
+	blockPending  blockState = 0
+	blockWritten  blockState = 1
+	blockVerified blockState = 2
+)
+
+// journalEntrySize : ブロック1件あたりのjournalレコードサイズ (state 1byte + crc32 4byte)
+const journalEntrySize = 5
+
+// journalEntry : 1ブロック分のjournalレコード
+type journalEntry struct {
+	state blockState
+	crc32 uint32
+}
+
+// Journal : 再開可能パッチのためのブロック単位の進捗を記録するサイドカーファイル
+type Journal struct {
+	path       string
+	blockCount uint
+	entries    []journalEntry
+}
+
+// newJournal : journalファイルを読み込む。存在しない、もしくはブロック数が
+// 合わない場合は全ブロックpendingの新しいjournalを作る
+func newJournal(path string, blockCount uint) (*Journal, error) {
+	j := &Journal{
+		path:       path,
+		blockCount: blockCount,
+		entries:    make([]journalEntry, blockCount),
+	}
+
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return j, nil
+		}
+		return nil, err
+	}
+
+	if uint(len(data)) != blockCount*journalEntrySize {
+		// ブロック数が変わっている場合は古いjournalを信用せずpendingから始める
+		return j, nil
+	}
+
+	for i := uint(0); i < blockCount; i++ {
+		off := i * journalEntrySize
+		j.entries[i] = journalEntry{
+			state: blockState(data[off]),
+			crc32: binary.LittleEndian.Uint32(data[off+1 : off+journalEntrySize]),
+		}
+	}
+
+	return j, nil
+}
+
+// State : 指定ブロックの現在の状態を返す
+func (j *Journal) State(index uint) blockState {
+	if index >= j.blockCount {
+		return blockPending
+	}
+	return j.entries[index].state
+}
+
+// MarkWritten : ブロックがtempファイルに書き込まれたことと、その内容のCRC32を記録する
+func (j *Journal) MarkWritten(index uint, crc uint32) {
+	if index >= j.blockCount {
+		return
+	}
+	j.entries[index] = journalEntry{state: blockWritten, crc32: crc}
+}
+
+// MarkVerified : 既に書き込まれたブロックがCRC検証済みであることを記録する
+func (j *Journal) MarkVerified(index uint) {
+	if index >= j.blockCount {
+		return
+	}
+	j.entries[index].state = blockVerified
+}
+
+// MarkPending : ブロックを未取得に戻す (CRC不一致時など)
+func (j *Journal) MarkPending(index uint) {
+	if index >= j.blockCount {
+		return
+	}
+	j.entries[index] = journalEntry{}
+}
+
+// Save : 現在のブロック状態をjournalファイルへ書き出す
+func (j *Journal) Save() error {
+	data := make([]byte, j.blockCount*journalEntrySize)
+
+	for i, entry := range j.entries {
+		off := uint(i) * journalEntrySize
+		data[off] = byte(entry.state)
+		binary.LittleEndian.PutUint32(data[off+1:off+journalEntrySize], entry.crc32)
+	}
+
+	return ioutil.WriteFile(j.path, data, 0644)
+}
+
+// verifyAgainstTemp : state=writtenのブロックについてtemp上のバイト列のCRC32を
+// 計算し、journalに記録されたCRCと一致すればverified、食い違えばpendingに戻す
+func (j *Journal) verifyAgainstTemp(temp io.ReaderAt, blockSize uint, fileSize int64) error {
+	buf := make([]byte, blockSize)
+
+	for index := uint(0); index < j.blockCount; index++ {
+		if j.State(index) != blockWritten {
+			continue
+		}
+
+		offset := int64(index) * int64(blockSize)
+		length := int64(blockSize)
+		if offset+length > fileSize {
+			length = fileSize - offset
+		}
+
+		n, err := temp.ReadAt(buf[:length], offset)
+		if err != nil && err != io.EOF {
+			return err
+		}
+
+		sum := crc32.ChecksumIEEE(buf[:n])
+		if sum == j.entries[index].crc32 {
+			j.MarkVerified(index)
+		} else {
+			j.MarkPending(index)
+		}
+	}
+
+	return nil
+}
+
+// resumableLocal : 既にtempへ書き込み済み・検証済みのブロックはtempから、
+// それ以外は元のローカルファイルから読み出すgosync.ReadSeekerAt
+//
+// rsyncのマッチングはこのReadSeekerAtをローカル側の入力として差分検出するので、
+// 既にダウンロード済みのブロックは「ローカルに一致するブロックがある」として扱われ、
+// BlockSourceBaseから再取得されない。
+type resumableLocal struct {
+	local     gosync.ReadSeekerAt
+	temp      *os.File
+	journal   *Journal
+	blockSize uint
+	pos       int64
+}
+
+func (r *resumableLocal) ReadAt(p []byte, off int64) (int, error) {
+	blockIndex := uint(off / int64(r.blockSize))
+
+	switch r.journal.State(blockIndex) {
+	case blockWritten, blockVerified:
+		return r.temp.ReadAt(p, off)
+	default:
+		return r.local.ReadAt(p, off)
+	}
+}
+
+func (r *resumableLocal) Read(p []byte) (int, error) {
+	n, err := r.ReadAt(p, r.pos)
+	r.pos += int64(n)
+	return n, err
+}
+
+func (r *resumableLocal) Seek(offset int64, whence int) (int64, error) {
+	switch whence {
+	case io.SeekStart:
+		r.pos = offset
+	case io.SeekCurrent:
+		r.pos += offset
+	case io.SeekEnd:
+		return r.local.Seek(offset, whence)
+	}
+	return r.pos, nil
+}
+
+// ResumableRSync : 中断/再開可能なパッチ適用を提供するgosync.RSyncのラッパー
+type ResumableRSync struct {
+	*gosync.RSync
+	journal   *Journal
+	temp      *os.File
+	blockSize uint
+	fileSize  int64
+}
+
+// NewResumableRSync : journalとtempの状態をもとにMakeRSyncを組み立て、
+// 既にダウンロード済みのブロックを再利用するResumableRSyncを作る
+func NewResumableRSync(local gosync.ReadSeekerAt, remote string, temp *os.File, fs gosync.FileSummary, journalPath string) (*ResumableRSync, error) {
+	blockSize := uint(fs.GetBlockSize())
+	fileSize := fs.GetFileSize()
+	blockCount := fs.GetBlockCount()
+
+	journal, err := newJournal(journalPath, blockCount)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := journal.verifyAgainstTemp(temp, blockSize, fileSize); err != nil {
+		return nil, err
+	}
+
+	resumed := &resumableLocal{
+		local:     local,
+		temp:      temp,
+		journal:   journal,
+		blockSize: blockSize,
+	}
+
+	return &ResumableRSync{
+		RSync:     MakeRSync(resumed, remote, temp, fs),
+		journal:   journal,
+		temp:      temp,
+		blockSize: blockSize,
+		fileSize:  fileSize,
+	}, nil
+}
+
+// Patch : 通常のRSync.Patchを実行し、完了後にtempの内容からjournalを更新して
+// ディスクへ保存する。失敗時でもそこまで書かれたブロックはjournalに残る
+func (r *ResumableRSync) Patch() error {
+	patchErr := r.RSync.Patch()
+
+	if err := markWrittenBlocksFromTemp(r.journal, r.temp, r.blockSize, r.fileSize); err != nil {
+		return err
+	}
+
+	if err := r.journal.Save(); err != nil {
+		return err
+	}
+
+	return patchErr
+}
+
+// markWrittenBlocksFromTemp : tempの内容を読み、完全に(エラーなく、ブロック全体分)
+// 読み出せたブロックだけをjournalにwritten状態として記録する。
+//
+// Patchが途中で失敗・中断しtempがfileSizeより短い場合、末尾側のブロックは
+// ReadAtがio.EOFとn=0(もしくは部分長)を返す。そのようなブロックを
+// crc32.ChecksumIEEE(nil)などで書き込み済みとして記録してしまうと、次回の
+// verifyAgainstTempがその場しのぎの0バイトCRCと一致してverifiedに昇格させてしまい、
+// 実際には取得していないブロックをtempから読んで再利用する事故につながる。
+// そのため、ブロック全長をエラーなく読めた場合にのみwrittenとして記録し、
+// それ以外のインデックスのjournal状態には一切触れない。
+func markWrittenBlocksFromTemp(journal *Journal, temp io.ReaderAt, blockSize uint, fileSize int64) error {
+	blockCount := journal.blockCount
+	buf := make([]byte, blockSize)
+
+	for index := uint(0); index < blockCount; index++ {
+		offset := int64(index) * int64(blockSize)
+		length := int64(blockSize)
+		if offset+length > fileSize {
+			length = fileSize - offset
+		}
+
+		n, err := temp.ReadAt(buf[:length], offset)
+		if err != nil || int64(n) != length {
+			// このブロックは今回の実行で完全には書かれていない。既存の
+			// journal状態(pendingのまま、あるいは以前のverified)を保持する。
+			continue
+		}
+
+		journal.MarkWritten(index, crc32.ChecksumIEEE(buf[:n]))
+	}
+
+	return nil
+}
+
+// Discard : journalファイルを削除し、再開情報を破棄する
+func Discard(journalPath string) error {
+	err := os.Remove(journalPath)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	return err
+}
@@ -0,0 +1,223 @@
+package main
+
+import (
+	"bytes"
+	"hash/crc32"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+	"time"
+
+	gosync "github.com/Redundancy/go-sync"
+)
+
+func TestMarkWrittenBlocksFromTempSkipsIncompleteBlocks(t *testing.T) {
+	const blockSize = 4
+	fileSize := int64(10) // 3 blocks: [0,4) [4,8) [8,10)
+
+	journalPath, cleanup := tempFilePath(t, "journal")
+	defer cleanup()
+
+	journal, err := newJournal(journalPath, 3)
+	if err != nil {
+		t.Fatalf("newJournal failed: %v", err)
+	}
+
+	temp, err := ioutil.TempFile("", "resumable-temp")
+	if err != nil {
+		t.Fatalf("TempFile failed: %v", err)
+	}
+	defer os.Remove(temp.Name())
+	defer temp.Close()
+
+	// Simulate a patch that only got through the first block before dropping:
+	// only the first 4 bytes were ever written to temp.
+	if _, err := temp.WriteAt([]byte("abcd"), 0); err != nil {
+		t.Fatalf("WriteAt failed: %v", err)
+	}
+
+	if err := markWrittenBlocksFromTemp(journal, temp, blockSize, fileSize); err != nil {
+		t.Fatalf("markWrittenBlocksFromTemp failed: %v", err)
+	}
+
+	if journal.State(0) != blockWritten {
+		t.Errorf("block 0 state = %v, want blockWritten", journal.State(0))
+	}
+	if journal.entries[0].crc32 != crc32.ChecksumIEEE([]byte("abcd")) {
+		t.Errorf("block 0 crc32 = %v, want crc of %q", journal.entries[0].crc32, "abcd")
+	}
+
+	if journal.State(1) != blockPending {
+		t.Errorf("block 1 state = %v, want blockPending (never fully written)", journal.State(1))
+	}
+	if journal.State(2) != blockPending {
+		t.Errorf("block 2 state = %v, want blockPending (never fully written)", journal.State(2))
+	}
+}
+
+func TestVerifyAgainstTempDoesNotPromoteNeverWrittenBlocks(t *testing.T) {
+	const blockSize = 4
+	fileSize := int64(10)
+
+	journalPath, cleanup := tempFilePath(t, "journal")
+	defer cleanup()
+
+	journal, err := newJournal(journalPath, 3)
+	if err != nil {
+		t.Fatalf("newJournal failed: %v", err)
+	}
+
+	temp, err := ioutil.TempFile("", "resumable-temp")
+	if err != nil {
+		t.Fatalf("TempFile failed: %v", err)
+	}
+	defer os.Remove(temp.Name())
+	defer temp.Close()
+
+	if _, err := temp.WriteAt([]byte("abcd"), 0); err != nil {
+		t.Fatalf("WriteAt failed: %v", err)
+	}
+
+	if err := markWrittenBlocksFromTemp(journal, temp, blockSize, fileSize); err != nil {
+		t.Fatalf("markWrittenBlocksFromTemp failed: %v", err)
+	}
+
+	if err := journal.verifyAgainstTemp(temp, blockSize, fileSize); err != nil {
+		t.Fatalf("verifyAgainstTemp failed: %v", err)
+	}
+
+	if journal.State(0) != blockVerified {
+		t.Errorf("block 0 state = %v, want blockVerified", journal.State(0))
+	}
+
+	// Blocks 1 and 2 were never obtained; they must stay pending so that
+	// resumableLocal re-requests them instead of serving garbage from temp.
+	if journal.State(1) != blockPending {
+		t.Errorf("block 1 state = %v, want blockPending", journal.State(1))
+	}
+	if journal.State(2) != blockPending {
+		t.Errorf("block 2 state = %v, want blockPending", journal.State(2))
+	}
+}
+
+// tempFilePath returns a path suitable for a journal file that does not yet
+// exist, plus a cleanup func to remove it after the test.
+func tempFilePath(t *testing.T, prefix string) (string, func()) {
+	t.Helper()
+
+	f, err := ioutil.TempFile("", prefix)
+	if err != nil {
+		t.Fatalf("TempFile failed: %v", err)
+	}
+	path := f.Name()
+	f.Close()
+	os.Remove(path)
+
+	return path, func() { os.Remove(path) }
+}
+
+func TestResumableRSyncPatchFetchesOnlyMissingBlocks(t *testing.T) {
+	const blockSize = 4
+	remoteContent := []byte("The quick brown fox jumped over the lazy dog")
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		http.ServeContent(w, req, "", time.Time{}, bytes.NewReader(remoteContent))
+	}))
+	defer server.Close()
+
+	encoded, err := EncodeChecksumIndex(bytes.NewReader(remoteContent), int64(len(remoteContent)), blockSize)
+	if err != nil {
+		t.Fatalf("EncodeChecksumIndex failed: %v", err)
+	}
+
+	fileSize, idx, lookup, err := DecodeChecksumIndex(encoded)
+	if err != nil {
+		t.Fatalf("DecodeChecksumIndex failed: %v", err)
+	}
+
+	blockCount := uint(fileSize) / blockSize
+	if uint(fileSize)%blockSize != 0 {
+		blockCount++
+	}
+
+	fs := &gosync.BasicSummary{
+		ChecksumIndex:  idx,
+		ChecksumLookup: lookup,
+		BlockCount:     blockCount,
+		BlockSize:      blockSize,
+		FileSize:       fileSize,
+	}
+
+	// The local copy already has the first two blocks correct; the rest
+	// diverges, so only the tail should need to be fetched from the server.
+	localContent := []byte("The quick XXXXXXXXXXXXXXXXXXXXXXXXXXXXX")
+	local := bytes.NewReader(localContent)
+
+	temp, err := ioutil.TempFile("", "resumable-e2e-temp")
+	if err != nil {
+		t.Fatalf("TempFile failed: %v", err)
+	}
+	defer os.Remove(temp.Name())
+	defer temp.Close()
+
+	journalPath, cleanup := tempFilePath(t, "resumable-e2e-journal")
+	defer cleanup()
+
+	rsync, err := NewResumableRSync(local, server.URL, temp, fs, journalPath)
+	if err != nil {
+		t.Fatalf("NewResumableRSync failed: %v", err)
+	}
+
+	if err := rsync.Patch(); err != nil {
+		t.Fatalf("Patch failed: %v", err)
+	}
+
+	if err := rsync.Close(); err != nil {
+		t.Fatalf("Close failed: %v", err)
+	}
+
+	patched, err := ioutil.ReadFile(temp.Name())
+	if err != nil {
+		t.Fatalf("ReadFile failed: %v", err)
+	}
+
+	if !bytes.Equal(patched, remoteContent) {
+		t.Fatalf("patched content = %q, want %q", patched, remoteContent)
+	}
+
+	journal, err := newJournal(journalPath, blockCount)
+	if err != nil {
+		t.Fatalf("newJournal failed: %v", err)
+	}
+
+	for i := uint(0); i < blockCount; i++ {
+		if journal.State(i) != blockWritten {
+			t.Errorf("block %d state = %v, want blockWritten", i, journal.State(i))
+		}
+	}
+
+	// Resuming should verify the temp file's contents against the journal's
+	// recorded CRCs and promote every block to verified.
+	if _, err := temp.Seek(0, io.SeekStart); err != nil {
+		t.Fatalf("Seek failed: %v", err)
+	}
+
+	if _, err := local.Seek(0, io.SeekStart); err != nil {
+		t.Fatalf("Seek failed: %v", err)
+	}
+
+	resumed, err := NewResumableRSync(local, server.URL, temp, fs, journalPath)
+	if err != nil {
+		t.Fatalf("NewResumableRSync (resume) failed: %v", err)
+	}
+	defer resumed.Close()
+
+	for i := uint(0); i < blockCount; i++ {
+		if resumed.journal.State(i) != blockVerified {
+			t.Errorf("after resume, block %d state = %v, want blockVerified", i, resumed.journal.State(i))
+		}
+	}
+}
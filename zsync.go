@@ -0,0 +1,183 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/sha1"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+
+	gosync "github.com/Redundancy/go-sync"
+	"github.com/Redundancy/go-sync/chunks"
+	"github.com/Redundancy/go-sync/filechecksum"
+	"github.com/Redundancy/go-sync/index"
+)
+
+// EncodeZsyncMetafile : 標準的なzsyncの.zsync形式でChecksumIndexをエンコードする
+//
+// テキストのヘッダ (Length / Blocksize / Hash-Lengths / URL / SHA-1) に続けて
+// weak+strongのブロックテーブルをバイナリで書き出す。EncodeChecksumIndexと違い
+// 既存のzsyncクライアント/CDNと相互運用できる。
+func EncodeZsyncMetafile(content io.Reader, fileSize int64, blockSize uint, url string) (io.ReadSeeker, error) {
+	generator := filechecksum.NewFileChecksumGenerator(blockSize)
+	weakSize := generator.WeakRollingHash.Size()
+	strongSize := generator.GetStrongHash().Size()
+
+	sha1Sum := sha1.New()
+	table := bytes.NewBuffer(nil)
+	_, err := generator.GenerateChecksums(io.TeeReader(content, sha1Sum), table)
+	if err != nil {
+		return nil, err
+	}
+
+	blockCount := table.Len() / (weakSize + strongSize)
+
+	b := bytes.NewBuffer(nil)
+	fmt.Fprintf(b, "zsync: 0.6.2\n")
+	fmt.Fprintf(b, "Length: %d\n", fileSize)
+	fmt.Fprintf(b, "Blocksize: %d\n", blockSize)
+	fmt.Fprintf(b, "Hash-Lengths: %d,%d,%d\n", seqMatchesFor(blockCount, weakSize), weakSize, strongSize)
+	fmt.Fprintf(b, "URL: %s\n", url)
+	fmt.Fprintf(b, "SHA-1: %x\n", sha1Sum.Sum(nil))
+	fmt.Fprintf(b, "\n")
+	b.Write(table.Bytes())
+
+	return bytes.NewReader(b.Bytes()), nil
+}
+
+// DecodeZsyncMetafile : EncodeZsyncMetafileが出力した.zsyncファイルをデコードする
+func DecodeZsyncMetafile(reader io.Reader) (fileSize int64, blockSize uint, idx *index.ChecksumIndex, lookup filechecksum.ChecksumLookup, url string, err error) {
+	br := bufio.NewReader(reader)
+
+	var seq, weakSize, strongSize int
+
+	for {
+		var line string
+		line, err = br.ReadString('\n')
+		if err != nil && err != io.EOF {
+			return
+		}
+
+		line = strings.TrimRight(line, "\r\n")
+		if line == "" {
+			break
+		}
+
+		parts := strings.SplitN(line, ":", 2)
+		if len(parts) != 2 {
+			continue
+		}
+
+		key := strings.TrimSpace(parts[0])
+		value := strings.TrimSpace(parts[1])
+
+		switch key {
+		case "Length":
+			fileSize, err = strconv.ParseInt(value, 10, 64)
+			if err != nil {
+				return
+			}
+		case "Blocksize":
+			var bs uint64
+			bs, err = strconv.ParseUint(value, 10, 32)
+			if err != nil {
+				return
+			}
+			blockSize = uint(bs)
+		case "Hash-Lengths":
+			lengths := strings.Split(value, ",")
+			if len(lengths) != 3 {
+				err = fmt.Errorf("invalid Hash-Lengths: %q", value)
+				return
+			}
+			seq, err = strconv.Atoi(lengths[0])
+			if err != nil {
+				return
+			}
+			weakSize, err = strconv.Atoi(lengths[1])
+			if err != nil {
+				return
+			}
+			strongSize, err = strconv.Atoi(lengths[2])
+			if err != nil {
+				return
+			}
+		case "URL":
+			url = value
+		}
+
+		if err == io.EOF {
+			break
+		}
+	}
+	err = nil
+
+	_ = seq
+
+	readChunks, chunkErr := chunks.LoadChecksumsFromReader(br, weakSize, strongSize)
+	if chunkErr != nil {
+		err = chunkErr
+		return
+	}
+
+	idx = index.MakeChecksumIndex(readChunks)
+	lookup = chunks.StrongChecksumGetter(readChunks)
+
+	return
+}
+
+// GetSummaryFromZsync : .zsyncファイルを取得してgosync.FileSummaryを組み立てる
+func GetSummaryFromZsync(zsyncURL string) (gosync.FileSummary, error) {
+	res, err := http.DefaultClient.Get(zsyncURL)
+	if err != nil {
+		return nil, err
+	}
+
+	defer res.Body.Close()
+
+	fileSize, blockSize, referenceFileIndex, checksumLookup, _, err := DecodeZsyncMetafile(res.Body)
+	if err != nil {
+		return nil, err
+	}
+
+	blockCount := uint(fileSize) / blockSize
+	if uint(fileSize)%blockSize != 0 {
+		blockCount++
+	}
+
+	fs := &gosync.BasicSummary{
+		ChecksumIndex:  referenceFileIndex,
+		ChecksumLookup: checksumLookup,
+		BlockCount:     blockCount,
+		BlockSize:      blockSize,
+		FileSize:       fileSize,
+	}
+
+	return fs, nil
+}
+
+// seqMatchesFor : Hash-Lengthsのseq-matchesを決める
+//
+// zsyncの実際のフォーマットでは、この値はブロック数ではなく「弱ハッシュの衝突を
+// 無視できる程度まで要求する連続一致数」(1か2)。弱ハッシュのビット数に対して
+// ブロック数が無視できないほど大きい場合は2ブロック連続の一致を要求し、
+// 誤ったブロックマッチを弾く。
+func seqMatchesFor(blockCount int, weakSize int) int {
+	if blockCount <= 1 {
+		return 1
+	}
+
+	rsumBits := uint(weakSize * 8)
+	if rsumBits >= 32 {
+		return 1
+	}
+
+	if blockCount > (1 << (rsumBits / 2)) {
+		return 2
+	}
+
+	return 1
+}
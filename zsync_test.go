@@ -0,0 +1,61 @@
+package main
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestEncodeDecodeZsyncMetafileRoundTrip(t *testing.T) {
+	content := []byte("The quick brown fox jumped over the lazy dog")
+
+	encoded, err := EncodeZsyncMetafile(bytes.NewReader(content), int64(len(content)), 4, "http://example.com/remote.txt")
+	if err != nil {
+		t.Fatalf("EncodeZsyncMetafile failed: %v", err)
+	}
+
+	fileSize, blockSize, idx, lookup, url, err := DecodeZsyncMetafile(encoded)
+	if err != nil {
+		t.Fatalf("DecodeZsyncMetafile failed: %v", err)
+	}
+
+	if fileSize != int64(len(content)) {
+		t.Errorf("fileSize = %d, want %d", fileSize, len(content))
+	}
+
+	if blockSize != 4 {
+		t.Errorf("blockSize = %d, want 4", blockSize)
+	}
+
+	if url != "http://example.com/remote.txt" {
+		t.Errorf("url = %q, want %q", url, "http://example.com/remote.txt")
+	}
+
+	if idx == nil {
+		t.Errorf("idx is nil")
+	}
+
+	if lookup == nil {
+		t.Errorf("lookup is nil")
+	}
+}
+
+func TestSeqMatchesFor(t *testing.T) {
+	cases := []struct {
+		blockCount int
+		weakSize   int
+		want       int
+	}{
+		{blockCount: 0, weakSize: 2, want: 1},
+		{blockCount: 1, weakSize: 2, want: 1},
+		{blockCount: 10, weakSize: 4, want: 1},    // 32-bit rsum: always disambiguates with 1 match
+		{blockCount: 10, weakSize: 2, want: 1},    // few blocks vs 16-bit rsum space
+		{blockCount: 1 << 20, weakSize: 2, want: 2}, // many blocks vs 16-bit rsum space
+	}
+
+	for _, c := range cases {
+		got := seqMatchesFor(c.blockCount, c.weakSize)
+		if got != c.want {
+			t.Errorf("seqMatchesFor(%d, %d) = %d, want %d", c.blockCount, c.weakSize, got, c.want)
+		}
+	}
+}